@@ -0,0 +1,330 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package v1alpha1
+
+import (
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// ServerSpec defines the desired state of the submarine-server Deployment.
+type ServerSpec struct {
+	// Replicas is the number of desired submarine-server pods.
+	// +optional
+	Replicas *int32 `json:"replicas,omitempty"`
+
+	// Image overrides the default submarine-server image.
+	// +optional
+	Image string `json:"image,omitempty"`
+
+	// Env lists extra environment variables merged into the submarine-server container.
+	// +optional
+	Env []corev1.EnvVar `json:"env,omitempty"`
+
+	// Autoscaling configures a HorizontalPodAutoscaler for submarine-server.
+	// When set, the operator stops managing Replicas directly and leaves it
+	// to the HPA.
+	// +optional
+	Autoscaling *AutoscalingSpec `json:"autoscaling,omitempty"`
+
+	// PodDisruptionBudget configures a PodDisruptionBudget for submarine-server.
+	// +optional
+	PodDisruptionBudget *PodDisruptionBudgetSpec `json:"podDisruptionBudget,omitempty"`
+
+	// Strategy selects how a new submarine-server revision is rolled out.
+	// Defaults to RollingUpdate (the single-Deployment behavior every other
+	// field in this spec already assumes) when unset.
+	// +optional
+	Strategy *ServerStrategy `json:"strategy,omitempty"`
+
+	// ProgressDeadlineSeconds is passed through to the submarine-server
+	// Deployment's spec.progressDeadlineSeconds, configuring how long the
+	// Deployment controller waits for rollout progress before surfacing
+	// ProgressDeadlineExceeded, which the phase/condition subsystem reports
+	// as Degraded. Defaults to the Deployment API's own default (600) when unset.
+	// +optional
+	ProgressDeadlineSeconds *int32 `json:"progressDeadlineSeconds,omitempty"`
+}
+
+// ServerStrategyType is the kind of rollout strategy used for a new
+// submarine-server revision.
+type ServerStrategyType string
+
+const (
+	// ServerStrategyRollingUpdate is the plain single-Deployment rollout
+	// strategy used when Strategy is unset.
+	ServerStrategyRollingUpdate ServerStrategyType = "RollingUpdate"
+	// ServerStrategyCanary ramps traffic from a stable Deployment to a
+	// canary Deployment according to Canary.Steps.
+	ServerStrategyCanary ServerStrategyType = "Canary"
+	// ServerStrategyBlueGreen keeps the Service pinned to the stable
+	// Deployment until the new (green) Deployment is Available, then flips
+	// the selector atomically.
+	ServerStrategyBlueGreen ServerStrategyType = "BlueGreen"
+)
+
+// ServerStrategy selects and configures how a new submarine-server revision
+// is rolled out.
+type ServerStrategy struct {
+	// Type selects the rollout strategy. Defaults to RollingUpdate.
+	// +optional
+	// +kubebuilder:validation:Enum=RollingUpdate;Canary;BlueGreen
+	Type ServerStrategyType `json:"type,omitempty"`
+
+	// Canary configures the Canary strategy. Only used when Type is Canary.
+	// +optional
+	Canary *CanaryStrategy `json:"canary,omitempty"`
+
+	// BlueGreen configures the BlueGreen strategy. Only used when Type is BlueGreen.
+	// +optional
+	BlueGreen *BlueGreenStrategy `json:"blueGreen,omitempty"`
+}
+
+// CanaryStrategy ramps traffic from the stable to the canary Deployment in
+// steps, pausing StepDuration between each, and rolls back to 0% canary
+// traffic if the canary Deployment fails readiness during a step.
+type CanaryStrategy struct {
+	// Weight is the percentage of traffic (0-100) sent to the canary
+	// Deployment when Steps is empty.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=100
+	Weight int32 `json:"weight,omitempty"`
+
+	// StepDuration is how long to wait at each step's weight before
+	// advancing to the next, unless the step itself sets Pause.
+	// +optional
+	StepDuration metav1.Duration `json:"stepDuration,omitempty"`
+
+	// Steps ramps the canary weight in stages; the last step should set
+	// Weight to 100 to complete the rollout.
+	// +optional
+	Steps []CanaryStep `json:"steps,omitempty"`
+}
+
+// CanaryStep is one stage of a Canary rollout.
+type CanaryStep struct {
+	// Weight is the percentage of traffic (0-100) sent to the canary
+	// Deployment once this step is reached.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=100
+	Weight int32 `json:"weight"`
+
+	// Pause overrides CanaryStrategy.StepDuration for this step only.
+	// +optional
+	Pause *metav1.Duration `json:"pause,omitempty"`
+}
+
+// BlueGreenStrategy keeps the live Service pointed at the stable (blue)
+// Deployment until the new (green) Deployment is Available, then either
+// promotes automatically or waits for an operator to promote it.
+type BlueGreenStrategy struct {
+	// PromoteAfter automatically promotes the green Deployment once it has
+	// been continuously Available for this long. Ignored if AutoPromote is
+	// false.
+	// +optional
+	PromoteAfter metav1.Duration `json:"promoteAfter,omitempty"`
+
+	// AutoPromote enables automatic promotion after PromoteAfter. When
+	// false, promotion must be triggered by an operator (e.g. by annotating
+	// the Submarine), and the green Deployment is held at 0% traffic once Ready.
+	// +optional
+	AutoPromote bool `json:"autoPromote,omitempty"`
+}
+
+// AutoscalingSpec configures a HorizontalPodAutoscaler for submarine-server.
+type AutoscalingSpec struct {
+	// MinReplicas is the lower replica bound the HPA will not scale below.
+	// +optional
+	MinReplicas *int32 `json:"minReplicas,omitempty"`
+
+	// MaxReplicas is the upper replica bound the HPA will not scale above.
+	MaxReplicas int32 `json:"maxReplicas"`
+
+	// TargetCPUUtilizationPercentage is the average CPU utilization the HPA
+	// scales towards.
+	// +optional
+	TargetCPUUtilizationPercentage *int32 `json:"targetCPUUtilizationPercentage,omitempty"`
+
+	// TargetMemoryUtilizationPercentage is the average memory utilization the
+	// HPA scales towards.
+	// +optional
+	TargetMemoryUtilizationPercentage *int32 `json:"targetMemoryUtilizationPercentage,omitempty"`
+
+	// Metrics lists additional custom/external metrics passed through
+	// verbatim to the HorizontalPodAutoscaler.
+	// +optional
+	Metrics []autoscalingv2.MetricSpec `json:"metrics,omitempty"`
+}
+
+// PodDisruptionBudgetSpec configures a PodDisruptionBudget for submarine-server.
+type PodDisruptionBudgetSpec struct {
+	// MinAvailable and MaxUnavailable are mutually exclusive, mirroring
+	// policy/v1.PodDisruptionBudgetSpec.
+	// +optional
+	MinAvailable *intstr.IntOrString `json:"minAvailable,omitempty"`
+	// +optional
+	MaxUnavailable *intstr.IntOrString `json:"maxUnavailable,omitempty"`
+}
+
+// CommonImageSpec defines images/pull-secrets shared by every submarine subsystem.
+type CommonImageSpec struct {
+	// +optional
+	BusyboxImage string `json:"busyboxImage,omitempty"`
+	// +optional
+	McImage string `json:"mcImage,omitempty"`
+	// +optional
+	PullSecrets []corev1.LocalObjectReference `json:"pullSecrets,omitempty"`
+}
+
+// SubmarineSpec defines the desired state of Submarine.
+type SubmarineSpec struct {
+	// Version is the submarine release used to build default subsystem images.
+	Version string `json:"version,omitempty"`
+
+	// Server configures the submarine-server Deployment.
+	// +optional
+	Server ServerSpec `json:"server,omitempty"`
+
+	// CommonImage configures images/pull-secrets shared across subsystems.
+	// +optional
+	CommonImage CommonImageSpec `json:"commonImage,omitempty"`
+}
+
+// SubmarineStatus defines the observed state of Submarine.
+type SubmarineStatus struct {
+	// Phase is a coarse-grained summary of where the Submarine is in its lifecycle.
+	// +optional
+	Phase SubmarinePhase `json:"phase,omitempty"`
+
+	// Conditions holds detailed, per-subsystem status of the Submarine.
+	// +optional
+	Conditions []SubmarineCondition `json:"conditions,omitempty"`
+
+	// Rollout tracks progress of an in-flight Canary/BlueGreen rollout.
+	// Only populated when Spec.Server.Strategy selects one of those types.
+	// +optional
+	Rollout *RolloutStatus `json:"rollout,omitempty"`
+}
+
+// RolloutStatus tracks progress of an in-flight Canary/BlueGreen rollout.
+type RolloutStatus struct {
+	// StableRevision is the server image last promoted: the one the stable
+	// Deployment (Canary) or the selected color's Deployment (BlueGreen) runs.
+	// +optional
+	StableRevision string `json:"stableRevision,omitempty"`
+
+	// CanaryWeight is the percentage of traffic (0-100) currently sent to
+	// the canary Deployment. Always 0 for BlueGreen.
+	// +optional
+	CanaryWeight int32 `json:"canaryWeight,omitempty"`
+
+	// CurrentStepIndex is the index into Spec.Server.Strategy.Canary.Steps
+	// the rollout has reached.
+	// +optional
+	CurrentStepIndex int `json:"currentStepIndex,omitempty"`
+
+	// LastStepTransitionTime is when CurrentStepIndex was last advanced.
+	// +optional
+	LastStepTransitionTime metav1.Time `json:"lastStepTransitionTime,omitempty"`
+
+	// StandbyAvailableSince is when a BlueGreen rollout's standby Deployment
+	// was first observed continuously Available, used to gate AutoPromote
+	// on BlueGreenStrategy.PromoteAfter. Reset to zero whenever the standby
+	// is observed not Available.
+	// +optional
+	StandbyAvailableSince metav1.Time `json:"standbyAvailableSince,omitempty"`
+}
+
+// SubmarinePhase is a coarse-grained summary of the Submarine lifecycle.
+type SubmarinePhase string
+
+const (
+	// SubmarinePhaseNew is set on a Submarine that has not yet been reconciled.
+	SubmarinePhaseNew SubmarinePhase = "New"
+	// SubmarinePhaseCreating is set while owned resources are still converging to Ready.
+	SubmarinePhaseCreating SubmarinePhase = "Creating"
+	// SubmarinePhaseRunning is set once every owned resource is Ready/Available.
+	SubmarinePhaseRunning SubmarinePhase = "Running"
+	// SubmarinePhaseFailed is set when an owned resource cannot become Ready within its deadline.
+	SubmarinePhaseFailed SubmarinePhase = "Failed"
+)
+
+// SubmarineConditionType is the type of a SubmarineCondition.
+type SubmarineConditionType string
+
+const (
+	// ServerReady indicates the submarine-server Deployment has the desired number of ready replicas.
+	ServerReady SubmarineConditionType = "ServerReady"
+	// ServerAvailable indicates the submarine-server Deployment has been continuously available.
+	ServerAvailable SubmarineConditionType = "ServerAvailable"
+	// ImagePullBackOff indicates a pod belonging to the submarine-server Deployment cannot pull its image.
+	ImagePullBackOff SubmarineConditionType = "ImagePullBackOff"
+	// Degraded indicates the submarine-server Deployment stopped making progress toward Ready.
+	Degraded SubmarineConditionType = "Degraded"
+	// HPAActive indicates the submarine-server HorizontalPodAutoscaler is able to calculate a desired replica count.
+	HPAActive SubmarineConditionType = "HPAActive"
+	// PDBHealthy indicates the submarine-server PodDisruptionBudget currently allows at least one disruption.
+	PDBHealthy SubmarineConditionType = "PDBHealthy"
+	// CanaryFailed indicates a Canary rollout's current step failed readiness and traffic was reverted to stable.
+	CanaryFailed SubmarineConditionType = "CanaryFailed"
+)
+
+// SubmarineCondition describes the state of one aspect of a Submarine at a point in time.
+type SubmarineCondition struct {
+	// Type of the condition.
+	Type SubmarineConditionType `json:"type"`
+	// Status of the condition, one of True, False, Unknown.
+	Status corev1.ConditionStatus `json:"status"`
+	// LastTransitionTime is the last time the condition transitioned from one status to another.
+	// +optional
+	LastTransitionTime metav1.Time `json:"lastTransitionTime,omitempty"`
+	// Reason is a brief machine-readable explanation for the condition's last transition.
+	// +optional
+	Reason string `json:"reason,omitempty"`
+	// Message is a human-readable explanation of the condition's last transition.
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+
+// Submarine is the Schema for the submarines API.
+type Submarine struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   SubmarineSpec   `json:"spec,omitempty"`
+	Status SubmarineStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// SubmarineList contains a list of Submarine.
+type SubmarineList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []Submarine `json:"items"`
+}
+
+// Note: DeepCopyObject and friends for the types above are produced by
+// `make generate` (controller-gen) into zz_generated.deepcopy.go and are
+// intentionally not hand-written here.
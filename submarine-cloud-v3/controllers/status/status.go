@@ -0,0 +1,202 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package status translates the status of owned Kubernetes resources (e.g.
+// the submarine-server Deployment) into the phase/condition subsystem
+// published on Submarine.Status.
+package status
+
+import (
+	"context"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	submarineapacheorgv1alpha1 "github.com/apache/submarine/submarine-cloud-v3/api/v1alpha1"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// SetCondition inserts or updates a condition on conditions, stamping
+// LastTransitionTime only when Status actually changes so repeated calls
+// with an unchanged Status are no-ops (idempotent).
+func SetCondition(conditions []submarineapacheorgv1alpha1.SubmarineCondition, condType submarineapacheorgv1alpha1.SubmarineConditionType, status corev1.ConditionStatus, reason, message string) []submarineapacheorgv1alpha1.SubmarineCondition {
+	now := metav1.Now()
+	for i := range conditions {
+		if conditions[i].Type != condType {
+			continue
+		}
+		if conditions[i].Status != status {
+			conditions[i].Status = status
+			conditions[i].LastTransitionTime = now
+		}
+		conditions[i].Reason = reason
+		conditions[i].Message = message
+		return conditions
+	}
+	return append(conditions, submarineapacheorgv1alpha1.SubmarineCondition{
+		Type:               condType,
+		Status:             status,
+		LastTransitionTime: now,
+		Reason:             reason,
+		Message:            message,
+	})
+}
+
+// FindCondition returns the condition of the given type, if present.
+func FindCondition(conditions []submarineapacheorgv1alpha1.SubmarineCondition, condType submarineapacheorgv1alpha1.SubmarineConditionType) *submarineapacheorgv1alpha1.SubmarineCondition {
+	for i := range conditions {
+		if conditions[i].Type == condType {
+			return &conditions[i]
+		}
+	}
+	return nil
+}
+
+// ForServerDeployment derives the next phase and conditions for a Submarine
+// from the observed status of its submarine-server Deployment. It lists the
+// Deployment's Pods to look for an image pull failure, but otherwise leaves
+// submarine untouched - including never mutating submarine.Status.Conditions
+// in place - so the caller can decide, once, whether the result actually
+// differs from submarine.Status before issuing a single Status().Update.
+func ForServerDeployment(ctx context.Context, c client.Client, submarine *submarineapacheorgv1alpha1.Submarine, deployment *appsv1.Deployment) (submarineapacheorgv1alpha1.SubmarinePhase, []submarineapacheorgv1alpha1.SubmarineCondition) {
+	// Copied rather than reused: SetCondition mutates a matching entry in
+	// place and returns the same backing array, so building on
+	// submarine.Status.Conditions directly would mutate it as we go and
+	// make the caller's later comparison against the "old" value a no-op.
+	conditions := append([]submarineapacheorgv1alpha1.SubmarineCondition{}, submarine.Status.Conditions...)
+
+	desired := int32(1)
+	if deployment.Spec.Replicas != nil {
+		desired = *deployment.Spec.Replicas
+	}
+
+	ready := deployment.Status.ReadyReplicas >= desired
+	available := deployment.Status.AvailableReplicas >= desired
+
+	if ready {
+		conditions = SetCondition(conditions, submarineapacheorgv1alpha1.ServerReady, corev1.ConditionTrue, "MinimumReplicasReady", "submarine-server has the desired number of ready replicas")
+	} else {
+		conditions = SetCondition(conditions, submarineapacheorgv1alpha1.ServerReady, corev1.ConditionFalse, "MinimumReplicasUnavailable", "submarine-server does not yet have the desired number of ready replicas")
+	}
+
+	if available {
+		conditions = SetCondition(conditions, submarineapacheorgv1alpha1.ServerAvailable, corev1.ConditionTrue, "MinimumReplicasAvailable", "submarine-server has the desired number of available replicas")
+	} else {
+		conditions = SetCondition(conditions, submarineapacheorgv1alpha1.ServerAvailable, corev1.ConditionFalse, "MinimumReplicasUnavailable", "submarine-server does not yet have the desired number of available replicas")
+	}
+
+	progressingFalseSince, degraded := progressDeadlineExceeded(deployment)
+	if degraded {
+		conditions = SetCondition(conditions, submarineapacheorgv1alpha1.Degraded, corev1.ConditionTrue, "ProgressDeadlineExceeded", "submarine-server Deployment has not made progress within its deadline")
+	} else {
+		conditions = SetCondition(conditions, submarineapacheorgv1alpha1.Degraded, corev1.ConditionFalse, "Progressing", "submarine-server Deployment is progressing")
+	}
+
+	if pullBackOff, reason := hasImagePullBackOff(ctx, c, deployment); pullBackOff {
+		conditions = SetCondition(conditions, submarineapacheorgv1alpha1.ImagePullBackOff, corev1.ConditionTrue, "ImagePullBackOff", reason)
+	} else {
+		conditions = SetCondition(conditions, submarineapacheorgv1alpha1.ImagePullBackOff, corev1.ConditionFalse, "ImagePullOk", "no image pull issues observed")
+	}
+
+	switch {
+	case degraded:
+		return submarineapacheorgv1alpha1.SubmarinePhaseFailed, conditions
+	case ready && available:
+		return submarineapacheorgv1alpha1.SubmarinePhaseRunning, conditions
+	case submarine.Status.Phase == "":
+		return submarineapacheorgv1alpha1.SubmarinePhaseNew, conditions
+	default:
+		_ = progressingFalseSince
+		return submarineapacheorgv1alpha1.SubmarinePhaseCreating, conditions
+	}
+}
+
+// ForHPA folds the observed state of a HorizontalPodAutoscaler into
+// conditions, recording whether it can currently calculate a desired
+// replica count.
+func ForHPA(conditions []submarineapacheorgv1alpha1.SubmarineCondition, hpa *autoscalingv2.HorizontalPodAutoscaler) []submarineapacheorgv1alpha1.SubmarineCondition {
+	for _, c := range hpa.Status.Conditions {
+		if c.Type != autoscalingv2.ScalingActive {
+			continue
+		}
+		return SetCondition(conditions, submarineapacheorgv1alpha1.HPAActive, c.Status, c.Reason, c.Message)
+	}
+	return SetCondition(conditions, submarineapacheorgv1alpha1.HPAActive, corev1.ConditionUnknown, "NoStatusYet", "HorizontalPodAutoscaler has not yet reported status")
+}
+
+// ForPDB folds the observed state of a PodDisruptionBudget into conditions,
+// recording whether it currently permits at least one voluntary disruption.
+func ForPDB(conditions []submarineapacheorgv1alpha1.SubmarineCondition, pdb *policyv1.PodDisruptionBudget) []submarineapacheorgv1alpha1.SubmarineCondition {
+	if pdb.Status.DisruptionsAllowed > 0 {
+		return SetCondition(conditions, submarineapacheorgv1alpha1.PDBHealthy, corev1.ConditionTrue, "DisruptionsAllowed", "PodDisruptionBudget currently permits a voluntary disruption")
+	}
+	return SetCondition(conditions, submarineapacheorgv1alpha1.PDBHealthy, corev1.ConditionFalse, "NoDisruptionsAllowed", "PodDisruptionBudget does not currently permit a voluntary disruption")
+}
+
+// progressDeadlineExceeded inspects the Deployment's own Progressing
+// condition (set by the deployment controller once the Deployment has made
+// no progress for longer than its, operator-configurable via
+// Spec.Server.ProgressDeadlineSeconds, spec.progressDeadlineSeconds) to
+// decide whether it has stalled.
+func progressDeadlineExceeded(deployment *appsv1.Deployment) (time.Time, bool) {
+	for _, c := range deployment.Status.Conditions {
+		if c.Type != appsv1.DeploymentProgressing {
+			continue
+		}
+		if c.Status == corev1.ConditionFalse && c.Reason == "ProgressDeadlineExceeded" {
+			return c.LastTransitionTime.Time, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// hasImagePullBackOff reports whether any Pod owned by the Deployment has a
+// container waiting on ImagePullBackOff/ErrImagePull. Kubernetes doesn't
+// surface an image-pull signal on the Deployment itself - that's only
+// visible on the Pods' container statuses - so this lists the Deployment's
+// Pods via its selector rather than inspecting Deployment-level conditions
+// (appsv1.DeploymentReplicaFailure covers unrelated replica-creation
+// failures, e.g. quota/forbidden errors, not image pulls).
+func hasImagePullBackOff(ctx context.Context, c client.Client, deployment *appsv1.Deployment) (bool, string) {
+	if deployment.Spec.Selector == nil {
+		return false, ""
+	}
+	selector, err := metav1.LabelSelectorAsSelector(deployment.Spec.Selector)
+	if err != nil {
+		return false, ""
+	}
+	pods := &corev1.PodList{}
+	if err := c.List(ctx, pods, client.InNamespace(deployment.Namespace), client.MatchingLabelsSelector{Selector: selector}); err != nil {
+		return false, ""
+	}
+	for _, pod := range pods.Items {
+		for _, cs := range pod.Status.ContainerStatuses {
+			if cs.State.Waiting == nil {
+				continue
+			}
+			if cs.State.Waiting.Reason == "ImagePullBackOff" || cs.State.Waiting.Reason == "ErrImagePull" {
+				return true, cs.State.Waiting.Message
+			}
+		}
+	}
+	return false, ""
+}
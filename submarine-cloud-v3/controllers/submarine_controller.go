@@ -0,0 +1,98 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package controllers
+
+import (
+	"context"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/go-logr/logr"
+
+	submarineapacheorgv1alpha1 "github.com/apache/submarine/submarine-cloud-v3/api/v1alpha1"
+)
+
+const (
+	serverName     = "submarine-server"
+	serverYamlPath = "../artifacts/submarine-server.yaml"
+
+	// MessageResourceExists is the message used for Events when a resource
+	// fails to sync because it already exists and is not managed by the Submarine.
+	MessageResourceExists = "Resource %q already exists and is not managed by Submarine"
+	// ErrResourceExists is the reason used for Events when a resource fails
+	// to sync because it already exists and is not managed by the Submarine.
+	ErrResourceExists = "ErrResourceExists"
+)
+
+// SubmarineReconciler reconciles a Submarine object.
+type SubmarineReconciler struct {
+	client.Client
+	Log      logr.Logger
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+
+	// SeldonGateway and SubmarineGateway are the Istio gateways injected into
+	// subsystem pods so they can be reached from outside the mesh.
+	SeldonGateway    string
+	SubmarineGateway string
+}
+
+// CreatePullSecrets converts a slice of LocalObjectReference read from the
+// CR/CommonImage spec into the form expected by PodSpec.ImagePullSecrets.
+func (r *SubmarineReconciler) CreatePullSecrets(pullSecrets *[]corev1.LocalObjectReference) []corev1.LocalObjectReference {
+	if pullSecrets == nil {
+		return nil
+	}
+	return *pullSecrets
+}
+
+// Reconcile is part of the main kubernetes reconciliation loop which aims to
+// move the current state of the cluster closer to the desired state.
+func (r *SubmarineReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	submarine := &submarineapacheorgv1alpha1.Submarine{}
+	if err := r.Get(ctx, req.NamespacedName, submarine); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	if err := r.createSubmarineServer(ctx, submarine); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	return ctrl.Result{}, nil
+}
+
+// SetupWithManager sets up the controller with the Manager. In addition to
+// watching Submarine itself, it watches the resources createSubmarineServer
+// owns: an edit to the child Deployment/Service/ServiceAccount (e.g. an
+// operator hand-editing the image, or Istio sidecar injection) re-triggers a
+// reconcile of the owning Submarine, via the default owner-reference
+// enqueue handler that Owns() installs, rather than only reacting to
+// changes to the Submarine CR itself.
+func (r *SubmarineReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&submarineapacheorgv1alpha1.Submarine{}).
+		Owns(&appsv1.Deployment{}).
+		Owns(&corev1.Service{}).
+		Owns(&corev1.ServiceAccount{}).
+		Complete(r)
+}
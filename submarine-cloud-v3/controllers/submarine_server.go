@@ -20,16 +20,20 @@ package controllers
 import (
 	"context"
 	"fmt"
+	"github.com/apache/submarine/submarine-cloud-v3/controllers/status"
 	"github.com/apache/submarine/submarine-cloud-v3/controllers/util"
 
 	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
 	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 
 	submarineapacheorgv1alpha1 "github.com/apache/submarine/submarine-cloud-v3/api/v1alpha1"
 
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 )
 
@@ -38,6 +42,11 @@ func (r *SubmarineReconciler) newSubmarineServerServiceAccount(ctx context.Conte
 	if err != nil {
 		r.Log.Error(err, "ParseServiceAccountYaml")
 	}
+	// Server-Side Apply marshals obj to JSON to compute the patch, so the
+	// GVK must be set explicitly; it isn't populated for us the way it is
+	// after a typed Get/List.
+	serviceAccount.TypeMeta = metav1.TypeMeta{APIVersion: "v1", Kind: "ServiceAccount"}
+	serviceAccount.Name = serverName
 	serviceAccount.Namespace = submarine.Namespace
 	err = controllerutil.SetControllerReference(submarine, serviceAccount, r.Scheme)
 	if err != nil {
@@ -51,6 +60,8 @@ func (r *SubmarineReconciler) newSubmarineServerService(ctx context.Context, sub
 	if err != nil {
 		r.Log.Error(err, "ParseServiceYaml")
 	}
+	service.TypeMeta = metav1.TypeMeta{APIVersion: "v1", Kind: "Service"}
+	service.Name = serverName
 	service.Namespace = submarine.Namespace
 	err = controllerutil.SetControllerReference(submarine, service, r.Scheme)
 	if err != nil {
@@ -105,21 +116,26 @@ func (r *SubmarineReconciler) newSubmarineServerDeployment(ctx context.Context,
 	if err != nil {
 		r.Log.Error(err, "ParseDeploymentYaml")
 	}
+	deployment.TypeMeta = metav1.TypeMeta{APIVersion: "apps/v1", Kind: "Deployment"}
+	deployment.Name = serverName
 	deployment.Namespace = submarine.Namespace
 	err = controllerutil.SetControllerReference(submarine, deployment, r.Scheme)
 	if err != nil {
 		r.Log.Error(err, "Set Deployment ControllerReference")
 	}
-	deployment.Spec.Replicas = &serverReplicas
+	// When an HPA is managing submarine-server, omit replicas from the
+	// applied object entirely so Server-Side Apply never reasserts
+	// Spec.Server.Replicas over the value the HPA has since scaled to.
+	if submarine.Spec.Server.Autoscaling == nil {
+		deployment.Spec.Replicas = &serverReplicas
+	}
+	if submarine.Spec.Server.ProgressDeadlineSeconds != nil {
+		deployment.Spec.ProgressDeadlineSeconds = submarine.Spec.Server.ProgressDeadlineSeconds
+	}
 	deployment.Spec.Template.Spec.Containers[0].Env = append(deployment.Spec.Template.Spec.Containers[0].Env, operatorEnv...)
 
 	// server image
-	serverImage := submarine.Spec.Server.Image
-	if serverImage != "" {
-		deployment.Spec.Template.Spec.Containers[0].Image = serverImage
-	} else {
-		deployment.Spec.Template.Spec.Containers[0].Image = fmt.Sprintf("apache/submarine:server-%s", submarine.Spec.Version)
-	}
+	deployment.Spec.Template.Spec.Containers[0].Image = resolveServerImage(submarine)
 	commonImage := util.GetSubmarineCommonImage(submarine)
 	// busybox image
 	busyboxImage := commonImage.BusyboxImage
@@ -140,148 +156,305 @@ func (r *SubmarineReconciler) newSubmarineServerDeployment(ctx context.Context,
 	return deployment
 }
 
+// resolveServerImage is the submarine-server image a Deployment should run:
+// Spec.Server.Image if set, otherwise the default image for Spec.Version.
+// Also used by the Canary/BlueGreen rollout strategies to tell "the new
+// image" apart from a previously-pinned revision's image.
+func resolveServerImage(submarine *submarineapacheorgv1alpha1.Submarine) string {
+	if submarine.Spec.Server.Image != "" {
+		return submarine.Spec.Server.Image
+	}
+	return fmt.Sprintf("apache/submarine:server-%s", submarine.Spec.Version)
+}
+
+// newSubmarineServerHPA builds the HPA that scales targetDeploymentName -
+// the Deployment reconcileServerWorkload returned for the currently-selected
+// Strategy as serving most or all of live traffic ("submarine-server" for
+// RollingUpdate; for Canary the stable Deployment, or the canary one once
+// its weight has reached 100; for BlueGreen the currently selected color).
+func (r *SubmarineReconciler) newSubmarineServerHPA(ctx context.Context, submarine *submarineapacheorgv1alpha1.Submarine, targetDeploymentName string) *autoscalingv2.HorizontalPodAutoscaler {
+	autoscaling := submarine.Spec.Server.Autoscaling
+	metrics := append([]autoscalingv2.MetricSpec{}, autoscaling.Metrics...)
+	if autoscaling.TargetCPUUtilizationPercentage != nil {
+		metrics = append(metrics, autoscalingv2.MetricSpec{
+			Type: autoscalingv2.ResourceMetricSourceType,
+			Resource: &autoscalingv2.ResourceMetricSource{
+				Name: corev1.ResourceCPU,
+				Target: autoscalingv2.MetricTarget{
+					Type:               autoscalingv2.UtilizationMetricType,
+					AverageUtilization: autoscaling.TargetCPUUtilizationPercentage,
+				},
+			},
+		})
+	}
+	if autoscaling.TargetMemoryUtilizationPercentage != nil {
+		metrics = append(metrics, autoscalingv2.MetricSpec{
+			Type: autoscalingv2.ResourceMetricSourceType,
+			Resource: &autoscalingv2.ResourceMetricSource{
+				Name: corev1.ResourceMemory,
+				Target: autoscalingv2.MetricTarget{
+					Type:               autoscalingv2.UtilizationMetricType,
+					AverageUtilization: autoscaling.TargetMemoryUtilizationPercentage,
+				},
+			},
+		})
+	}
+
+	hpa := &autoscalingv2.HorizontalPodAutoscaler{
+		TypeMeta: metav1.TypeMeta{APIVersion: "autoscaling/v2", Kind: "HorizontalPodAutoscaler"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      serverName,
+			Namespace: submarine.Namespace,
+		},
+		Spec: autoscalingv2.HorizontalPodAutoscalerSpec{
+			ScaleTargetRef: autoscalingv2.CrossVersionObjectReference{
+				APIVersion: "apps/v1",
+				Kind:       "Deployment",
+				Name:       targetDeploymentName,
+			},
+			MinReplicas: autoscaling.MinReplicas,
+			MaxReplicas: autoscaling.MaxReplicas,
+			Metrics:     metrics,
+		},
+	}
+	if err := controllerutil.SetControllerReference(submarine, hpa, r.Scheme); err != nil {
+		r.Log.Error(err, "Set HorizontalPodAutoscaler ControllerReference")
+	}
+	return hpa
+}
+
+func (r *SubmarineReconciler) newSubmarineServerPDB(ctx context.Context, submarine *submarineapacheorgv1alpha1.Submarine) *policyv1.PodDisruptionBudget {
+	pdbSpec := submarine.Spec.Server.PodDisruptionBudget
+
+	pdb := &policyv1.PodDisruptionBudget{
+		TypeMeta: metav1.TypeMeta{APIVersion: "policy/v1", Kind: "PodDisruptionBudget"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      serverName,
+			Namespace: submarine.Namespace,
+		},
+		Spec: policyv1.PodDisruptionBudgetSpec{
+			MinAvailable:   pdbSpec.MinAvailable,
+			MaxUnavailable: pdbSpec.MaxUnavailable,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{"app": serverName},
+			},
+		},
+	}
+	if err := controllerutil.SetControllerReference(submarine, pdb, r.Scheme); err != nil {
+		r.Log.Error(err, "Set PodDisruptionBudget ControllerReference")
+	}
+	return pdb
+}
+
 // createSubmarineServer is a function to create submarine-server.
 // Reference: https://github.com/apache/submarine/blob/master/submarine-cloud-v3/artifacts/submarine-server.yaml
+//
+// Every owned object is reconciled via Server-Side Apply (util.ApplyOwned):
+// the desired object is submitted with FieldOwner("submarine-operator") and
+// Force enabled, and Kubernetes computes the create-or-update diff for us.
+// This means the operator only ever owns the fields it actually sets -
+// unlike a hand-written comparison, it can't miss a field (resources,
+// tolerations, nodeSelector, probes, securityContext, volume mounts, ...)
+// and silently ignore future CRD additions, and it co-exists cleanly with
+// fields set by something else, such as an Istio sidecar injection webhook
+// adding a container/annotations, or an HPA writing .spec.replicas.
 func (r *SubmarineReconciler) createSubmarineServer(ctx context.Context, submarine *submarineapacheorgv1alpha1.Submarine) error {
 	r.Log.Info("Enter createSubmarineServer")
 
-	// Step1: Create ServiceAccount
+	// Step1: ServiceAccount
 	serviceaccount := &corev1.ServiceAccount{}
 	err := r.Get(ctx, types.NamespacedName{Name: serverName, Namespace: submarine.Namespace}, serviceaccount)
-
-	// If the resource doesn't exist, we'll create it
-	if errors.IsNotFound(err) {
-		serviceaccount = r.newSubmarineServerServiceAccount(ctx, submarine)
-		err = r.Create(ctx, serviceaccount)
-		r.Log.Info("Create ServiceAccount", "name", serviceaccount.Name)
-	}
-
-	// If an error occurs during Get/Create, we'll requeue the item so we can
-	// attempt processing again later. This could have been caused by a
-	// temporary network failure, or any other transient reason.
-	if err != nil {
+	if err != nil && !errors.IsNotFound(err) {
 		return err
 	}
-
-	if !metav1.IsControlledBy(serviceaccount, submarine) {
+	if err == nil && !metav1.IsControlledBy(serviceaccount, submarine) {
 		msg := fmt.Sprintf(MessageResourceExists, serviceaccount.Name)
 		r.Recorder.Event(submarine, corev1.EventTypeWarning, ErrResourceExists, msg)
 		return fmt.Errorf(msg)
 	}
+	if err := util.ApplyOwned(ctx, r.Client, r.newSubmarineServerServiceAccount(ctx, submarine)); err != nil {
+		return err
+	}
 
-	// Step2: Create Service
+	// Step2: Service
 	service := &corev1.Service{}
 	err = r.Get(ctx, types.NamespacedName{Name: serverName, Namespace: submarine.Namespace}, service)
-	// If the resource doesn't exist, we'll create it
-	if errors.IsNotFound(err) {
-		service = r.newSubmarineServerService(ctx, submarine)
-		err = r.Create(ctx, service)
-		r.Log.Info("Create Service", "name", service.Name)
-	}
-
-	// If an error occurs during Get/Create, we'll requeue the item so we can
-	// attempt processing again later. This could have been caused by a
-	// temporary network failure, or any other transient reason.
-	if err != nil {
-		if errors.IsNotFound(err) {
-			return nil
-		}
+	if err != nil && !errors.IsNotFound(err) {
 		return err
 	}
-
-	if !metav1.IsControlledBy(service, submarine) {
+	if err == nil && !metav1.IsControlledBy(service, submarine) {
 		msg := fmt.Sprintf(MessageResourceExists, service.Name)
 		r.Recorder.Event(submarine, corev1.EventTypeWarning, ErrResourceExists, msg)
 		return fmt.Errorf(msg)
 	}
-
-	// Step3: Create Deployment
-	deployment := &appsv1.Deployment{}
-	err = r.Get(ctx, types.NamespacedName{Name: serverName, Namespace: submarine.Namespace}, deployment)
-	// If the resource doesn't exist, we'll create it
-	if errors.IsNotFound(err) {
-		deployment = r.newSubmarineServerDeployment(ctx, submarine)
-		err = r.Create(ctx, deployment)
-		r.Log.Info("Create Deployment", "name", deployment.Name)
-	} else {
-		newDeployment := r.newSubmarineServerDeployment(ctx, submarine)
-		// compare if there are same
-		if !CompareServerDeployment(deployment, newDeployment) {
-			// update meta with uid
-			newDeployment.ObjectMeta = deployment.ObjectMeta
-			err = r.Update(ctx, newDeployment)
-			r.Log.Info("Update Deployment", "name", deployment.Name)
+	// Under BlueGreen, reconcileBlueGreenRollout applies this Service itself
+	// with its color selector; applying the plain Service here as well would
+	// drop that selector on every reconcile.
+	strategy := submarine.Spec.Server.Strategy
+	if strategy == nil || strategy.Type != submarineapacheorgv1alpha1.ServerStrategyBlueGreen || strategy.BlueGreen == nil {
+		if err := util.ApplyOwned(ctx, r.Client, r.newSubmarineServerService(ctx, submarine)); err != nil {
+			return err
 		}
 	}
 
-	// If an error occurs during Get/Create, we'll requeue the item so we can
-	// attempt processing again later. This could have been caused by a
-	// temporary network failure, or any other transient reason.
+	// Step3: Deployment. The workload is dispatched to
+	// reconcileServerWorkload, which honors Spec.Server.Strategy - a plain
+	// RollingUpdate keeps reconciling the single submarine-server
+	// Deployment as before, while Canary/BlueGreen stand up their own
+	// revision Deployments and Service/VirtualService traffic split.
+	// newRollout/canaryFailed are not written into submarine.Status here -
+	// updateSubmarineServerStatus folds them in alongside the Deployment's
+	// own status so the whole transition is compared and persisted
+	// atomically, in one Status().Update.
+	latestDeployment, newRollout, canaryFailed, err := r.reconcileServerWorkload(ctx, submarine)
 	if err != nil {
-		if errors.IsNotFound(err) {
-			return nil
-		}
 		return err
 	}
 
-	if !metav1.IsControlledBy(deployment, submarine) {
-		msg := fmt.Sprintf(MessageResourceExists, deployment.Name)
-		r.Recorder.Event(submarine, corev1.EventTypeWarning, ErrResourceExists, msg)
-		return fmt.Errorf(msg)
+	// Step3.5/3.6: reconcile the optional HPA/PDB, tearing either down if its
+	// spec field has been removed from the CR. The HPA scales
+	// latestDeployment rather than always "submarine-server": under
+	// Canary/BlueGreen that name is a revision Deployment
+	// ("submarine-server-stable"/"-blue"/...), and no plain
+	// "submarine-server" Deployment exists to scale at all.
+	if err := r.reconcileSubmarineServerHPA(ctx, submarine, latestDeployment.Name); err != nil {
+		return err
+	}
+	if err := r.reconcileSubmarineServerPDB(ctx, submarine); err != nil {
+		return err
 	}
 
-	return nil
+	// Step4: translate the workload's observed status into the Submarine's
+	// phase/condition subsystem.
+	return r.updateSubmarineServerStatus(ctx, submarine, latestDeployment, newRollout, canaryFailed)
 }
 
-// CompareServerDeployment will determine if two Deployments are equal
-func CompareServerDeployment(oldDeployment, newDeployment *appsv1.Deployment) bool {
-	// spec.replicas
-	if *oldDeployment.Spec.Replicas != *newDeployment.Spec.Replicas {
-		return false
+// updateSubmarineServerStatus derives the Submarine's phase and conditions
+// from the submarine-server Deployment status, folds in the HPA/PDB/rollout
+// conditions when those subsystems are enabled, and, if anything actually
+// changed, issues a single Status().Update so the transition is atomic.
+// newRollout and canaryFailed come from reconcileServerWorkload rather than
+// being written into submarine.Status by it directly, so the comparisons
+// below see the pre-reconcile values instead of ones already mutated to
+// match - the same reason ForServerDeployment copies submarine.Status.Conditions
+// instead of building on it in place.
+func (r *SubmarineReconciler) updateSubmarineServerStatus(ctx context.Context, submarine *submarineapacheorgv1alpha1.Submarine, deployment *appsv1.Deployment, newRollout *submarineapacheorgv1alpha1.RolloutStatus, canaryFailed *bool) error {
+	newPhase, newConditions := status.ForServerDeployment(ctx, r.Client, submarine, deployment)
+
+	if canaryFailed != nil {
+		if *canaryFailed {
+			newConditions = status.SetCondition(newConditions, submarineapacheorgv1alpha1.CanaryFailed, corev1.ConditionTrue, "CanaryReadinessFailed", "canary Deployment failed to become ready during its rollout step; traffic reverted to stable")
+		} else {
+			newConditions = status.SetCondition(newConditions, submarineapacheorgv1alpha1.CanaryFailed, corev1.ConditionFalse, "CanaryHealthy", "canary rollout is progressing")
+		}
 	}
 
-	if len(oldDeployment.Spec.Template.Spec.Containers) != 1 {
-		return false
+	if submarine.Spec.Server.Autoscaling != nil {
+		hpa := &autoscalingv2.HorizontalPodAutoscaler{}
+		if err := r.Get(ctx, types.NamespacedName{Name: serverName, Namespace: submarine.Namespace}, hpa); err == nil {
+			newConditions = status.ForHPA(newConditions, hpa)
+		}
 	}
-	// spec.template.spec.containers[0].env
-	if !util.CompareEnv(oldDeployment.Spec.Template.Spec.Containers[0].Env,
-		newDeployment.Spec.Template.Spec.Containers[0].Env) {
-		return false
+	if submarine.Spec.Server.PodDisruptionBudget != nil {
+		pdb := &policyv1.PodDisruptionBudget{}
+		if err := r.Get(ctx, types.NamespacedName{Name: serverName, Namespace: submarine.Namespace}, pdb); err == nil {
+			newConditions = status.ForPDB(newConditions, pdb)
+		}
 	}
-	// spec.template.spec.containers[0].image
-	if oldDeployment.Spec.Template.Spec.Containers[0].Image !=
-		newDeployment.Spec.Template.Spec.Containers[0].Image {
-		return false
+
+	if newPhase == submarine.Status.Phase && conditionsEqual(submarine.Status.Conditions, newConditions) && rolloutEqual(submarine.Status.Rollout, newRollout) {
+		return nil
 	}
 
-	if len(oldDeployment.Spec.Template.Spec.InitContainers) != 2 {
-		return false
+	oldPhase := submarine.Status.Phase
+	submarine.Status.Phase = newPhase
+	submarine.Status.Conditions = newConditions
+	submarine.Status.Rollout = newRollout
+	if err := r.Status().Update(ctx, submarine); err != nil {
+		return err
 	}
-	// spec.template.spec.initContainers[0].image
-	if oldDeployment.Spec.Template.Spec.InitContainers[0].Image != newDeployment.
-		Spec.Template.Spec.InitContainers[0].Image {
-		return false
+	if oldPhase != newPhase {
+		r.Recorder.Event(submarine, corev1.EventTypeNormal, "PhaseChanged", fmt.Sprintf("Submarine transitioned from phase %q to %q", oldPhase, newPhase))
 	}
-	// spec.template.spec.initContainers[0].command
-	if !util.CompareSlice(oldDeployment.Spec.Template.Spec.InitContainers[0].Command,
-		newDeployment.Spec.Template.Spec.InitContainers[0].Command) {
-		return false
+	return nil
+}
+
+// rolloutEqual reports whether two RolloutStatus pointers carry the same
+// fields; nil-safe so a Submarine with no Canary/BlueGreen Strategy (both
+// nil) compares equal.
+func rolloutEqual(a, b *submarineapacheorgv1alpha1.RolloutStatus) bool {
+	if a == nil || b == nil {
+		return a == b
 	}
-	// spec.template.spec.initContainers[1].image
-	if oldDeployment.Spec.Template.Spec.InitContainers[1].Image !=
-		newDeployment.Spec.Template.Spec.InitContainers[1].Image {
+	return a.StableRevision == b.StableRevision &&
+		a.CanaryWeight == b.CanaryWeight &&
+		a.CurrentStepIndex == b.CurrentStepIndex &&
+		a.LastStepTransitionTime.Equal(&b.LastStepTransitionTime) &&
+		a.StandbyAvailableSince.Equal(&b.StandbyAvailableSince)
+}
+
+// conditionsEqual reports whether two condition slices carry the same
+// Type/Status/Reason/Message, ignoring LastTransitionTime.
+func conditionsEqual(a, b []submarineapacheorgv1alpha1.SubmarineCondition) bool {
+	if len(a) != len(b) {
 		return false
 	}
-	// spec.template.spec.initContainers[1].command
-	if !util.CompareSlice(oldDeployment.Spec.Template.Spec.InitContainers[1].Command,
-		newDeployment.Spec.Template.Spec.InitContainers[1].Command) {
-		return false
+	index := make(map[submarineapacheorgv1alpha1.SubmarineConditionType]submarineapacheorgv1alpha1.SubmarineCondition, len(a))
+	for _, c := range a {
+		index[c.Type] = c
 	}
-
-	// spec.template.spec.imagePullSecrets
-	if !util.ComparePullSecrets(oldDeployment.Spec.Template.Spec.ImagePullSecrets,
-		newDeployment.Spec.Template.Spec.ImagePullSecrets) {
-		return false
+	for _, c := range b {
+		existing, ok := index[c.Type]
+		if !ok || existing.Status != c.Status || existing.Reason != c.Reason || existing.Message != c.Message {
+			return false
+		}
 	}
 	return true
 }
+
+// reconcileSubmarineServerHPA creates/updates the submarine-server HPA when
+// Spec.Server.Autoscaling is set, scaling targetDeploymentName (the
+// Deployment reconcileServerWorkload just reconciled for the current
+// Strategy), and deletes it if a previously-created HPA is found but the
+// field has since been removed from the CR.
+func (r *SubmarineReconciler) reconcileSubmarineServerHPA(ctx context.Context, submarine *submarineapacheorgv1alpha1.Submarine, targetDeploymentName string) error {
+	hpa := &autoscalingv2.HorizontalPodAutoscaler{}
+	err := r.Get(ctx, types.NamespacedName{Name: serverName, Namespace: submarine.Namespace}, hpa)
+
+	if submarine.Spec.Server.Autoscaling == nil {
+		if err == nil {
+			r.Log.Info("Delete HorizontalPodAutoscaler", "name", hpa.Name)
+			return r.Delete(ctx, hpa)
+		}
+		return client.IgnoreNotFound(err)
+	}
+
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+
+	return util.ApplyOwned(ctx, r.Client, r.newSubmarineServerHPA(ctx, submarine, targetDeploymentName))
+}
+
+// reconcileSubmarineServerPDB creates/updates the submarine-server PDB when
+// Spec.Server.PodDisruptionBudget is set, and deletes it if a
+// previously-created PDB is found but the field has since been removed from
+// the CR.
+func (r *SubmarineReconciler) reconcileSubmarineServerPDB(ctx context.Context, submarine *submarineapacheorgv1alpha1.Submarine) error {
+	pdb := &policyv1.PodDisruptionBudget{}
+	err := r.Get(ctx, types.NamespacedName{Name: serverName, Namespace: submarine.Namespace}, pdb)
+
+	if submarine.Spec.Server.PodDisruptionBudget == nil {
+		if err == nil {
+			r.Log.Info("Delete PodDisruptionBudget", "name", pdb.Name)
+			return r.Delete(ctx, pdb)
+		}
+		return client.IgnoreNotFound(err)
+	}
+
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+
+	return util.ApplyOwned(ctx, r.Client, r.newSubmarineServerPDB(ctx, submarine))
+}
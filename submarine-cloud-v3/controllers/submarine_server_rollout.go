@@ -0,0 +1,497 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+
+	submarineapacheorgv1alpha1 "github.com/apache/submarine/submarine-cloud-v3/api/v1alpha1"
+
+	"github.com/apache/submarine/submarine-cloud-v3/controllers/util"
+
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+const (
+	versionLabel = "version"
+
+	stableSuffix = "-stable"
+	canarySuffix = "-canary"
+	blueSuffix   = "-blue"
+	greenSuffix  = "-green"
+
+	// promoteAnnotation triggers manual promotion of a BlueGreen rollout
+	// that has AutoPromote disabled, e.g.
+	// `kubectl annotate submarine foo submarine.apache.org/promote=true`.
+	promoteAnnotation = "submarine.apache.org/promote"
+)
+
+// virtualServiceGVK is Istio's VirtualService, built as Unstructured so the
+// operator can split canary traffic without taking a hard client-go
+// dependency on istio.io/client-go; the CRD may not even be installed on a
+// cluster that isn't running the mesh.
+var virtualServiceGVK = schema.GroupVersionKind{
+	Group:   "networking.istio.io",
+	Version: "v1beta1",
+	Kind:    "VirtualService",
+}
+
+// destinationRuleGVK is Istio's DestinationRule, which defines the
+// "stable"/"canary" subsets the VirtualService's route destinations
+// reference; built as Unstructured for the same reason as virtualServiceGVK.
+var destinationRuleGVK = schema.GroupVersionKind{
+	Group:   "networking.istio.io",
+	Version: "v1beta1",
+	Kind:    "DestinationRule",
+}
+
+// reconcileServerWorkload reconciles the submarine-server workload
+// according to Spec.Server.Strategy and returns the Deployment that best
+// represents current serving traffic, for the phase/condition subsystem to
+// read status from. Defaulting to RollingUpdate keeps the original
+// single-Deployment behavior every other field (Autoscaling, PDB, ...)
+// already assumes. The returned RolloutStatus/canaryFailed (nil unless a
+// Canary/BlueGreen Strategy is active) are not written into submarine.Status
+// here - updateSubmarineServerStatus folds them into the same Status().Update
+// as the phase/conditions it derives from the returned Deployment.
+func (r *SubmarineReconciler) reconcileServerWorkload(ctx context.Context, submarine *submarineapacheorgv1alpha1.Submarine) (*appsv1.Deployment, *submarineapacheorgv1alpha1.RolloutStatus, *bool, error) {
+	strategy := submarine.Spec.Server.Strategy
+	switch {
+	case strategy != nil && strategy.Type == submarineapacheorgv1alpha1.ServerStrategyCanary && strategy.Canary != nil:
+		if err := r.deleteServerDeployments(ctx, submarine, serverName, serverName+blueSuffix, serverName+greenSuffix); err != nil {
+			return nil, nil, nil, err
+		}
+		deployment, rollout, canaryFailed, err := r.reconcileCanaryRollout(ctx, submarine)
+		return deployment, rollout, canaryFailed, err
+	case strategy != nil && strategy.Type == submarineapacheorgv1alpha1.ServerStrategyBlueGreen && strategy.BlueGreen != nil:
+		if err := r.deleteServerDeployments(ctx, submarine, serverName, serverName+stableSuffix, serverName+canarySuffix); err != nil {
+			return nil, nil, nil, err
+		}
+		deployment, rollout, err := r.reconcileBlueGreenRollout(ctx, submarine)
+		return deployment, rollout, nil, err
+	default:
+		if err := r.deleteServerDeployments(ctx, submarine, serverName+stableSuffix, serverName+canarySuffix, serverName+blueSuffix, serverName+greenSuffix); err != nil {
+			return nil, nil, nil, err
+		}
+		if err := util.ApplyOwned(ctx, r.Client, r.newSubmarineServerDeployment(ctx, submarine)); err != nil {
+			return nil, nil, nil, err
+		}
+		deployment := &appsv1.Deployment{}
+		err := r.Get(ctx, types.NamespacedName{Name: serverName, Namespace: submarine.Namespace}, deployment)
+		return deployment, nil, nil, err
+	}
+}
+
+// deleteServerDeployments deletes each named Deployment still present and
+// controlled by submarine. Called with the Deployment names that belong to
+// the rollout Strategy types *other* than the one currently selected, so
+// switching Spec.Server.Strategy.Type tears down the previous strategy's
+// Deployments (e.g. the plain "submarine-server" Deployment when moving to
+// Canary, or "-stable"/"-canary" when moving back to RollingUpdate) instead
+// of leaving them running forever - the same delete-when-no-longer-selected
+// pattern reconcileSubmarineServerHPA/PDB use for their own optional fields.
+func (r *SubmarineReconciler) deleteServerDeployments(ctx context.Context, submarine *submarineapacheorgv1alpha1.Submarine, names ...string) error {
+	for _, name := range names {
+		deployment := &appsv1.Deployment{}
+		err := r.Get(ctx, types.NamespacedName{Name: name, Namespace: submarine.Namespace}, deployment)
+		if err != nil {
+			if errors.IsNotFound(err) {
+				continue
+			}
+			return err
+		}
+		if !metav1.IsControlledBy(deployment, submarine) {
+			continue
+		}
+		r.Log.Info("Delete stale submarine-server Deployment", "name", name)
+		if err := r.Delete(ctx, deployment); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// newSubmarineServerRevisionDeployment builds a variant of the
+// submarine-server Deployment (e.g. "submarine-server-stable") carrying a
+// "version" label so a Service/VirtualService can select it independently
+// of its sibling revision, running image rather than whatever
+// newSubmarineServerDeployment would otherwise resolve - so the caller can
+// pin this revision to a previously-observed image instead of always
+// rolling it forward to the Submarine's current Spec.Server.Image.
+func (r *SubmarineReconciler) newSubmarineServerRevisionDeployment(ctx context.Context, submarine *submarineapacheorgv1alpha1.Submarine, nameSuffix, version, image string) *appsv1.Deployment {
+	deployment := r.newSubmarineServerDeployment(ctx, submarine)
+	deployment.Name = serverName + nameSuffix
+	deployment.Spec.Template.Spec.Containers[0].Image = image
+	if deployment.Spec.Template.Labels == nil {
+		deployment.Spec.Template.Labels = map[string]string{}
+	}
+	deployment.Spec.Template.Labels[versionLabel] = version
+	if deployment.Spec.Selector == nil {
+		deployment.Spec.Selector = &metav1.LabelSelector{}
+	}
+	if deployment.Spec.Selector.MatchLabels == nil {
+		deployment.Spec.Selector.MatchLabels = map[string]string{}
+	}
+	deployment.Spec.Selector.MatchLabels[versionLabel] = version
+	return deployment
+}
+
+// reconcileCanaryRollout runs the Canary strategy: it keeps a "-stable" and
+// a "-canary" Deployment side by side, and a VirtualService splitting
+// traffic between them by weight, ramping through
+// Spec.Server.Strategy.Canary.Steps. If the canary Deployment fails
+// readiness partway through a step, traffic is reverted to 100% stable and
+// the rollout is marked CanaryFailed rather than continuing to ramp up a
+// broken revision.
+//
+// The stable Deployment is pinned to rollout.StableRevision - the image
+// last promoted - rather than resolveServerImage(submarine), so bumping
+// Spec.Server.Image only ever changes the canary Deployment until the ramp
+// completes; otherwise both Deployments would always run an identical spec
+// and the traffic split would mitigate nothing. StableRevision is promoted
+// to the new image once the ramp reaches its last, 100%-weight step.
+func (r *SubmarineReconciler) reconcileCanaryRollout(ctx context.Context, submarine *submarineapacheorgv1alpha1.Submarine) (*appsv1.Deployment, *submarineapacheorgv1alpha1.RolloutStatus, *bool, error) {
+	canary := submarine.Spec.Server.Strategy.Canary
+
+	currentRollout := submarine.Status.Rollout
+	if currentRollout == nil {
+		currentRollout = &submarineapacheorgv1alpha1.RolloutStatus{}
+	}
+
+	canaryImage := resolveServerImage(submarine)
+	stableImage := currentRollout.StableRevision
+	if stableImage == "" {
+		stableImage = canaryImage
+	}
+	// A completed rollout (canary at 100%) whose promoted image no longer
+	// matches the resolved server image starts over from the first step.
+	if currentRollout.CanaryWeight >= 100 && canaryImage != stableImage {
+		currentRollout = &submarineapacheorgv1alpha1.RolloutStatus{StableRevision: stableImage}
+	}
+
+	stableDeployment := r.newSubmarineServerRevisionDeployment(ctx, submarine, stableSuffix, "stable", stableImage)
+	canaryDeployment := r.newSubmarineServerRevisionDeployment(ctx, submarine, canarySuffix, "canary", canaryImage)
+
+	if err := util.ApplyOwned(ctx, r.Client, stableDeployment); err != nil {
+		return nil, nil, nil, err
+	}
+	if err := util.ApplyOwned(ctx, r.Client, canaryDeployment); err != nil {
+		return nil, nil, nil, err
+	}
+
+	observedCanary := &appsv1.Deployment{}
+	if err := r.Get(ctx, types.NamespacedName{Name: canaryDeployment.Name, Namespace: submarine.Namespace}, observedCanary); err != nil {
+		return nil, nil, nil, err
+	}
+
+	weight, stepIndex, advanced, failed := advanceCanarySteps(canary, currentRollout, observedCanary, time.Now())
+	newRollout := &submarineapacheorgv1alpha1.RolloutStatus{
+		StableRevision:         stableImage,
+		CanaryWeight:           weight,
+		CurrentStepIndex:       stepIndex,
+		LastStepTransitionTime: currentRollout.LastStepTransitionTime,
+	}
+	// Only restamped when the step changed or its clock is first started, since it's the clock
+	// advanceCanarySteps measures StepDuration/Pause against - stamping it
+	// on every reconcile would mean "time since the last reconcile" instead
+	// of "time spent at this step", and the rollout would never pause.
+	if advanced {
+		newRollout.LastStepTransitionTime = metav1.Now()
+	}
+	if weight >= 100 {
+		// The canary has fully replaced stable; promote it so the next
+		// Spec.Server.Image bump starts a fresh rollout from the image
+		// that's actually live, not the one that was live before this one.
+		newRollout.StableRevision = canaryImage
+	}
+
+	destinationRule := r.newSubmarineServerCanaryDestinationRule(submarine)
+	if err := util.ApplyOwned(ctx, r.Client, destinationRule); err != nil {
+		return nil, nil, nil, err
+	}
+
+	virtualService := r.newSubmarineServerCanaryVirtualService(submarine, weight)
+	if err := util.ApplyOwned(ctx, r.Client, virtualService); err != nil {
+		return nil, nil, nil, err
+	}
+
+	if weight >= 100 {
+		return observedCanary, newRollout, &failed, nil
+	}
+	observedStable := &appsv1.Deployment{}
+	if err := r.Get(ctx, types.NamespacedName{Name: stableDeployment.Name, Namespace: submarine.Namespace}, observedStable); err != nil {
+		return nil, nil, nil, err
+	}
+	return observedStable, newRollout, &failed, nil
+}
+
+// advanceCanarySteps decides the next canary weight/step index given the
+// canary Deployment's current readiness. It never advances past a step
+// whose canary Deployment isn't ready, and reverts to 0% (step 0) the
+// moment the canary Deployment is observed unready after the rollout had
+// already advanced - i.e. a regression rolls back rather than holding at a
+// half-shipped weight. Advancing from one ready step to the next is gated
+// on having held the current step for at least its Pause (falling back to
+// CanaryStrategy.StepDuration) - advanced reports whether stepIndex changed
+// this call or the current step's clock had not been started yet, telling
+// the caller whether to restamp LastStepTransitionTime, the clock this gate
+// measures against.
+func advanceCanarySteps(canary *submarineapacheorgv1alpha1.CanaryStrategy, rollout *submarineapacheorgv1alpha1.RolloutStatus, canaryDeployment *appsv1.Deployment, now time.Time) (weight int32, stepIndex int, advanced, failed bool) {
+	ready := canaryDeployment.Status.Replicas > 0 && canaryDeployment.Status.ReadyReplicas >= canaryDeployment.Status.Replicas
+
+	if !ready {
+		if rollout.CurrentStepIndex > 0 || rollout.CanaryWeight > 0 {
+			return 0, 0, true, true
+		}
+		return 0, 0, false, false
+	}
+
+	steps := canary.Steps
+	if len(steps) == 0 {
+		return canary.Weight, 0, false, false
+	}
+
+	currentIndex := rollout.CurrentStepIndex
+	if currentIndex >= len(steps) {
+		currentIndex = len(steps) - 1
+	}
+
+	// LastStepTransitionTime is zero the first time the rollout observes
+	// this step (e.g. right after starting or after a revert); start the
+	// pause clock now rather than treating a zero time as "infinitely long
+	// ago" and skipping the pause entirely.
+	startedAt := rollout.LastStepTransitionTime.Time
+	if startedAt.IsZero() {
+		return steps[currentIndex].Weight, currentIndex, true, false
+	}
+
+	if currentIndex >= len(steps)-1 {
+		return steps[currentIndex].Weight, currentIndex, false, false
+	}
+
+	pause := canary.StepDuration.Duration
+	if steps[currentIndex].Pause != nil {
+		pause = steps[currentIndex].Pause.Duration
+	}
+	if now.Sub(startedAt) < pause {
+		return steps[currentIndex].Weight, currentIndex, false, false
+	}
+
+	currentIndex++
+	return steps[currentIndex].Weight, currentIndex, true, false
+}
+
+// newSubmarineServerCanaryDestinationRule defines the "stable"/"canary"
+// subsets, selected by the "version" Pod label newSubmarineServerRevisionDeployment
+// sets, that newSubmarineServerCanaryVirtualService's route destinations
+// reference. Istio rejects a VirtualService subset with no matching
+// DestinationRule, so this must be applied alongside it.
+func (r *SubmarineReconciler) newSubmarineServerCanaryDestinationRule(submarine *submarineapacheorgv1alpha1.Submarine) *unstructured.Unstructured {
+	dr := &unstructured.Unstructured{}
+	dr.SetGroupVersionKind(destinationRuleGVK)
+	dr.SetName(serverName)
+	dr.SetNamespace(submarine.Namespace)
+	_ = unstructured.SetNestedField(dr.Object, serverName, "spec", "host")
+	_ = unstructured.SetNestedSlice(dr.Object, []interface{}{
+		map[string]interface{}{
+			"name":   "stable",
+			"labels": map[string]interface{}{versionLabel: "stable"},
+		},
+		map[string]interface{}{
+			"name":   "canary",
+			"labels": map[string]interface{}{versionLabel: "canary"},
+		},
+	}, "spec", "subsets")
+	if err := controllerutil.SetControllerReference(submarine, dr, r.Scheme); err != nil {
+		r.Log.Error(err, "Set DestinationRule ControllerReference")
+	}
+	return dr
+}
+
+// newSubmarineServerCanaryVirtualService splits traffic between the stable
+// and canary Deployments by weight (0-100, canary's share).
+func (r *SubmarineReconciler) newSubmarineServerCanaryVirtualService(submarine *submarineapacheorgv1alpha1.Submarine, canaryWeight int32) *unstructured.Unstructured {
+	vs := &unstructured.Unstructured{}
+	vs.SetGroupVersionKind(virtualServiceGVK)
+	vs.SetName(serverName)
+	vs.SetNamespace(submarine.Namespace)
+	_ = unstructured.SetNestedStringSlice(vs.Object, []string{serverName}, "spec", "hosts")
+	_ = unstructured.SetNestedSlice(vs.Object, []interface{}{
+		map[string]interface{}{
+			"route": []interface{}{
+				map[string]interface{}{
+					"destination": map[string]interface{}{
+						"host":   serverName,
+						"subset": "stable",
+					},
+					"weight": int64(100 - canaryWeight),
+				},
+				map[string]interface{}{
+					"destination": map[string]interface{}{
+						"host":   serverName,
+						"subset": "canary",
+					},
+					"weight": int64(canaryWeight),
+				},
+			},
+		},
+	}, "spec", "http")
+	if err := controllerutil.SetControllerReference(submarine, vs, r.Scheme); err != nil {
+		r.Log.Error(err, "Set VirtualService ControllerReference")
+	}
+	return vs
+}
+
+// reconcileBlueGreenRollout runs the BlueGreen strategy: the live Service
+// keeps selecting the active color's pods until the other ("standby")
+// color's Deployment is Available, at which point it either promotes
+// automatically, once the standby has been continuously Available for
+// BlueGreenStrategy.PromoteAfter, or waits for an operator to set
+// promoteAnnotation (which promotes immediately, bypassing PromoteAfter).
+//
+// The active color's Deployment is pinned to rollout.StableRevision - the
+// image last promoted - rather than resolveServerImage(submarine), so
+// bumping Spec.Server.Image only ever changes the standby color's
+// Deployment until it's promoted; otherwise both colors would always run
+// an identical spec and the rollout would provide no safety margin.
+func (r *SubmarineReconciler) reconcileBlueGreenRollout(ctx context.Context, submarine *submarineapacheorgv1alpha1.Submarine) (*appsv1.Deployment, *submarineapacheorgv1alpha1.RolloutStatus, error) {
+	blueGreen := submarine.Spec.Server.Strategy.BlueGreen
+
+	currentRollout := submarine.Status.Rollout
+	if currentRollout == nil {
+		currentRollout = &submarineapacheorgv1alpha1.RolloutStatus{}
+	}
+
+	activeColor := r.currentActiveColor(ctx, submarine)
+	standbyColor := "green"
+	if activeColor == "green" {
+		standbyColor = "blue"
+	}
+
+	standbyImage := resolveServerImage(submarine)
+	activeImage := currentRollout.StableRevision
+	if activeImage == "" {
+		activeImage = standbyImage
+	}
+	colorImages := map[string]string{activeColor: activeImage, standbyColor: standbyImage}
+
+	blueDeployment := r.newSubmarineServerRevisionDeployment(ctx, submarine, blueSuffix, "blue", colorImages["blue"])
+	greenDeployment := r.newSubmarineServerRevisionDeployment(ctx, submarine, greenSuffix, "green", colorImages["green"])
+	if err := util.ApplyOwned(ctx, r.Client, blueDeployment); err != nil {
+		return nil, nil, err
+	}
+	if err := util.ApplyOwned(ctx, r.Client, greenDeployment); err != nil {
+		return nil, nil, err
+	}
+
+	activeDeployment := &appsv1.Deployment{}
+	if err := r.Get(ctx, types.NamespacedName{Name: serverName + "-" + activeColor, Namespace: submarine.Namespace}, activeDeployment); err != nil {
+		return nil, nil, err
+	}
+	standbyDeployment := &appsv1.Deployment{}
+	if err := r.Get(ctx, types.NamespacedName{Name: serverName + "-" + standbyColor, Namespace: submarine.Namespace}, standbyDeployment); err != nil {
+		return nil, nil, err
+	}
+
+	standbyAvailable := deploymentAvailable(standbyDeployment)
+	manualPromote := submarine.Annotations[promoteAnnotation] == "true"
+	standbyAvailableSince, promote := advanceBlueGreenPromotion(blueGreen, currentRollout.StandbyAvailableSince, standbyAvailable, manualPromote, time.Now())
+
+	selectedColor := activeColor
+	newActiveImage := activeImage
+	if promote {
+		selectedColor = standbyColor
+		newActiveImage = standbyImage
+		standbyAvailableSince = metav1.Time{}
+	}
+
+	service := r.newSubmarineServerService(ctx, submarine)
+	service.Spec.Selector = map[string]string{versionLabel: selectedColor}
+	if err := util.ApplyOwned(ctx, r.Client, service); err != nil {
+		return nil, nil, err
+	}
+
+	newRollout := &submarineapacheorgv1alpha1.RolloutStatus{
+		StableRevision:        newActiveImage,
+		StandbyAvailableSince: standbyAvailableSince,
+	}
+
+	if promote {
+		return standbyDeployment, newRollout, nil
+	}
+	return activeDeployment, newRollout, nil
+}
+
+// advanceBlueGreenPromotion decides whether traffic should flip to the
+// standby color given its current Available status, and reports the
+// (possibly updated) time the standby has been continuously Available
+// since. Automatic promotion (AutoPromote) is gated on having held that
+// Available status for at least PromoteAfter; manual promotion
+// (promoteAnnotation) fires as soon as the standby is Available,
+// bypassing the wait. standbyAvailableSince resets to zero whenever the
+// standby is observed not Available, so a regression restarts the clock
+// rather than promoting off a stale Available streak.
+func advanceBlueGreenPromotion(blueGreen *submarineapacheorgv1alpha1.BlueGreenStrategy, standbyAvailableSince metav1.Time, standbyAvailable, manualPromote bool, now time.Time) (metav1.Time, bool) {
+	if !standbyAvailable {
+		return metav1.Time{}, false
+	}
+	if standbyAvailableSince.IsZero() {
+		standbyAvailableSince = metav1.NewTime(now)
+	}
+	if manualPromote {
+		return standbyAvailableSince, true
+	}
+	if blueGreen.AutoPromote && now.Sub(standbyAvailableSince.Time) >= blueGreen.PromoteAfter.Duration {
+		return standbyAvailableSince, true
+	}
+	return standbyAvailableSince, false
+}
+
+// currentActiveColor reads which color the live submarine-server Service
+// currently selects, defaulting to "blue" the first time a BlueGreen
+// rollout is configured for this Submarine.
+func (r *SubmarineReconciler) currentActiveColor(ctx context.Context, submarine *submarineapacheorgv1alpha1.Submarine) string {
+	existing := &corev1.Service{}
+	if err := r.Get(ctx, types.NamespacedName{Name: serverName, Namespace: submarine.Namespace}, existing); err != nil {
+		return "blue"
+	}
+	if color, ok := existing.Spec.Selector[versionLabel]; ok && (color == "blue" || color == "green") {
+		return color
+	}
+	return "blue"
+}
+
+// deploymentAvailable reports whether a Deployment has its Available
+// condition set to True.
+func deploymentAvailable(deployment *appsv1.Deployment) bool {
+	for _, c := range deployment.Status.Conditions {
+		if c.Type == appsv1.DeploymentAvailable {
+			return c.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
@@ -0,0 +1,45 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package util
+
+import (
+	"context"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// FieldOwner is the field manager name the operator uses for every Server-Side
+// Apply patch it submits.
+const FieldOwner = "submarine-operator"
+
+// ApplyOwned submits obj via Server-Side Apply with Force enabled, so
+// Kubernetes computes the diff against the live object and the operator
+// only ever owns the fields it sets on obj. Fields set by another manager
+// (e.g. an Istio sidecar injection webhook adding a container/annotations,
+// or an HPA writing .spec.replicas) are left untouched since this operator
+// never includes them in obj.
+//
+// Force is required so the first Apply from this field manager succeeds
+// even when the object already exists and some of its fields are currently
+// owned by another manager (e.g. a pre-SSA `kubectl apply`/Create+Update
+// managed-fields entry from before this operator adopted Server-Side
+// Apply) - Force reassigns ownership of any overlapping field to
+// "submarine-operator" instead of conflicting.
+func ApplyOwned(ctx context.Context, c client.Client, obj client.Object) error {
+	return c.Patch(ctx, obj, client.Apply, client.ForceOwnership, client.FieldOwner(FieldOwner))
+}
@@ -0,0 +1,54 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package util
+
+import (
+	corev1 "k8s.io/api/core/v1"
+
+	submarineapacheorgv1alpha1 "github.com/apache/submarine/submarine-cloud-v3/api/v1alpha1"
+)
+
+const (
+	defaultBusyboxImage = "busybox:1.34.1"
+	defaultMcImage      = "minio/mc:RELEASE.2021-10-07T04-19-58Z"
+)
+
+// CommonImage is the resolved set of images/pull-secrets shared by every
+// submarine subsystem, falling back to operator defaults when unset.
+type CommonImage struct {
+	BusyboxImage string
+	McImage      string
+	PullSecrets  []corev1.LocalObjectReference
+}
+
+// GetSubmarineCommonImage resolves the CommonImage spec on the Submarine CR,
+// filling in operator defaults for any field the user left empty.
+func GetSubmarineCommonImage(submarine *submarineapacheorgv1alpha1.Submarine) CommonImage {
+	commonImage := CommonImage{
+		BusyboxImage: submarine.Spec.CommonImage.BusyboxImage,
+		McImage:      submarine.Spec.CommonImage.McImage,
+		PullSecrets:  submarine.Spec.CommonImage.PullSecrets,
+	}
+	if commonImage.BusyboxImage == "" {
+		commonImage.BusyboxImage = defaultBusyboxImage
+	}
+	if commonImage.McImage == "" {
+		commonImage.McImage = defaultMcImage
+	}
+	return commonImage
+}
@@ -0,0 +1,68 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package util
+
+import (
+	"io/ioutil"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// ParseServiceAccountYaml reads the ServiceAccount object embedded in the
+// artifact manifest at path.
+func ParseServiceAccountYaml(path string) (*corev1.ServiceAccount, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	serviceAccount := &corev1.ServiceAccount{}
+	if err := yaml.Unmarshal(data, serviceAccount); err != nil {
+		return nil, err
+	}
+	return serviceAccount, nil
+}
+
+// ParseServiceYaml reads the Service object embedded in the artifact
+// manifest at path.
+func ParseServiceYaml(path string) (*corev1.Service, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	service := &corev1.Service{}
+	if err := yaml.Unmarshal(data, service); err != nil {
+		return nil, err
+	}
+	return service, nil
+}
+
+// ParseDeploymentYaml reads the Deployment object embedded in the artifact
+// manifest at path.
+func ParseDeploymentYaml(path string) (*appsv1.Deployment, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	deployment := &appsv1.Deployment{}
+	if err := yaml.Unmarshal(data, deployment); err != nil {
+		return nil, err
+	}
+	return deployment, nil
+}
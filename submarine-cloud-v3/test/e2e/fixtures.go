@@ -0,0 +1,131 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package e2e
+
+import (
+	"context"
+
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	submarineapacheorgv1alpha1 "github.com/apache/submarine/submarine-cloud-v3/api/v1alpha1"
+)
+
+// SubmarineBuilder incrementally builds a Submarine CR for a test case, so
+// individual specs only need to name the fields they care about instead of
+// repeating the full object literal. Future subsystem suites (MLflow,
+// Tensorboard, MinIO) can add their own With* methods here without
+// reinventing this scaffolding.
+type SubmarineBuilder struct {
+	submarine submarineapacheorgv1alpha1.Submarine
+}
+
+// NewSubmarineBuilder returns a builder for a minimal, valid Submarine named
+// name in namespace.
+func NewSubmarineBuilder(name, namespace string) *SubmarineBuilder {
+	replicas := int32(1)
+	return &SubmarineBuilder{
+		submarine: submarineapacheorgv1alpha1.Submarine{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: namespace,
+			},
+			Spec: submarineapacheorgv1alpha1.SubmarineSpec{
+				Version: "0.8.0",
+				Server: submarineapacheorgv1alpha1.ServerSpec{
+					Replicas: &replicas,
+				},
+			},
+		},
+	}
+}
+
+// WithReplicas sets Spec.Server.Replicas.
+func (b *SubmarineBuilder) WithReplicas(replicas int32) *SubmarineBuilder {
+	b.submarine.Spec.Server.Replicas = &replicas
+	return b
+}
+
+// WithServerImage sets Spec.Server.Image.
+func (b *SubmarineBuilder) WithServerImage(image string) *SubmarineBuilder {
+	b.submarine.Spec.Server.Image = image
+	return b
+}
+
+// WithServerEnv appends to Spec.Server.Env.
+func (b *SubmarineBuilder) WithServerEnv(env ...corev1.EnvVar) *SubmarineBuilder {
+	b.submarine.Spec.Server.Env = append(b.submarine.Spec.Server.Env, env...)
+	return b
+}
+
+// WithPullSecrets sets Spec.CommonImage.PullSecrets.
+func (b *SubmarineBuilder) WithPullSecrets(names ...string) *SubmarineBuilder {
+	refs := make([]corev1.LocalObjectReference, 0, len(names))
+	for _, n := range names {
+		refs = append(refs, corev1.LocalObjectReference{Name: n})
+	}
+	b.submarine.Spec.CommonImage.PullSecrets = refs
+	return b
+}
+
+// WithAutoscaling sets Spec.Server.Autoscaling.
+func (b *SubmarineBuilder) WithAutoscaling(minReplicas, maxReplicas int32) *SubmarineBuilder {
+	b.submarine.Spec.Server.Autoscaling = &submarineapacheorgv1alpha1.AutoscalingSpec{
+		MinReplicas: &minReplicas,
+		MaxReplicas: maxReplicas,
+	}
+	return b
+}
+
+// WithPodDisruptionBudget sets Spec.Server.PodDisruptionBudget to a fixed
+// minAvailable count.
+func (b *SubmarineBuilder) WithPodDisruptionBudget(minAvailable int) *SubmarineBuilder {
+	minAvailableIntStr := intstr.FromInt(minAvailable)
+	b.submarine.Spec.Server.PodDisruptionBudget = &submarineapacheorgv1alpha1.PodDisruptionBudgetSpec{
+		MinAvailable: &minAvailableIntStr,
+	}
+	return b
+}
+
+// Build returns the built Submarine.
+func (b *SubmarineBuilder) Build() *submarineapacheorgv1alpha1.Submarine {
+	return b.submarine.DeepCopy()
+}
+
+// Create builds and creates the Submarine against k8sClient, returning it.
+func (b *SubmarineBuilder) Create(ctx context.Context) *submarineapacheorgv1alpha1.Submarine {
+	submarine := b.Build()
+	Expect(k8sClient.Create(ctx, submarine)).To(Succeed())
+	return submarine
+}
+
+// WaitForSubmarinePhase polls until the named Submarine reports phase, or
+// fails the spec once defaultWait elapses.
+func WaitForSubmarinePhase(ctx context.Context, name, namespace string, phase submarineapacheorgv1alpha1.SubmarinePhase) {
+	submarine := &submarineapacheorgv1alpha1.Submarine{}
+	Eventually(func() submarineapacheorgv1alpha1.SubmarinePhase {
+		if err := k8sClient.Get(ctx, types.NamespacedName{Name: name, Namespace: namespace}, submarine); err != nil {
+			return ""
+		}
+		return submarine.Status.Phase
+	}, defaultWait, defaultPoll).Should(Equal(phase))
+}
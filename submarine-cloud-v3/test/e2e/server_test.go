@@ -0,0 +1,131 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package e2e
+
+import (
+	"context"
+	"fmt"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	submarineapacheorgv1alpha1 "github.com/apache/submarine/submarine-cloud-v3/api/v1alpha1"
+)
+
+var _ = Describe("submarine-server reconcile", func() {
+	var (
+		ctx       context.Context
+		namespace string
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		ns := &corev1.Namespace{}
+		ns.GenerateName = "submarine-e2e-"
+		Expect(k8sClient.Create(ctx, ns)).To(Succeed())
+		namespace = ns.Name
+	})
+
+	It("creates a ServiceAccount/Service/Deployment owned by the Submarine", func() {
+		submarine := NewSubmarineBuilder("server-create", namespace).
+			WithServerEnv(corev1.EnvVar{Name: "FOO", Value: "bar"}).
+			Create(ctx)
+
+		var deployment appsv1.Deployment
+		Eventually(func() error {
+			return k8sClient.Get(ctx, types.NamespacedName{Name: "submarine-server", Namespace: namespace}, &deployment)
+		}, defaultWait, defaultPoll).Should(Succeed())
+		Expect(deployment.OwnerReferences).To(ContainElement(HaveField("UID", submarine.UID)))
+
+		var service corev1.Service
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Name: "submarine-server", Namespace: namespace}, &service)).To(Succeed())
+		Expect(service.OwnerReferences).To(ContainElement(HaveField("UID", submarine.UID)))
+
+		var serviceAccount corev1.ServiceAccount
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Name: "submarine-server", Namespace: namespace}, &serviceAccount)).To(Succeed())
+		Expect(serviceAccount.OwnerReferences).To(ContainElement(HaveField("UID", submarine.UID)))
+
+		env := deployment.Spec.Template.Spec.Containers[0].Env
+		Expect(env).To(ContainElement(corev1.EnvVar{Name: "FOO", Value: "bar"}))
+		Expect(env).To(ContainElement(corev1.EnvVar{Name: "SUBMARINE_ISTIO_SELDON_GATEWAY", Value: ""}))
+		Expect(env).To(ContainElement(corev1.EnvVar{Name: "SUBMARINE_ISTIO_SUBMARINE_GATEWAY", Value: ""}))
+
+		WaitForSubmarinePhase(ctx, submarine.Name, namespace, submarineapacheorgv1alpha1.SubmarinePhaseRunning)
+	})
+
+	It("patches the Deployment when Replicas/Image/Env/PullSecrets change", func() {
+		submarine := NewSubmarineBuilder("server-mutate", namespace).Create(ctx)
+
+		Eventually(func() error {
+			var deployment appsv1.Deployment
+			return k8sClient.Get(ctx, types.NamespacedName{Name: "submarine-server", Namespace: namespace}, &deployment)
+		}, defaultWait, defaultPoll).Should(Succeed())
+
+		Eventually(func() error {
+			var latest submarineapacheorgv1alpha1.Submarine
+			if err := k8sClient.Get(ctx, types.NamespacedName{Name: submarine.Name, Namespace: namespace}, &latest); err != nil {
+				return err
+			}
+			replicas := int32(3)
+			latest.Spec.Server.Replicas = &replicas
+			latest.Spec.Server.Image = "apache/submarine:server-custom"
+			latest.Spec.Server.Env = []corev1.EnvVar{{Name: "NEW_ENV", Value: "1"}}
+			latest.Spec.CommonImage.PullSecrets = []corev1.LocalObjectReference{{Name: "regcred"}}
+			return k8sClient.Update(ctx, &latest)
+		}, defaultWait, defaultPoll).Should(Succeed())
+
+		var deployment appsv1.Deployment
+		Eventually(func() int32 {
+			if err := k8sClient.Get(ctx, types.NamespacedName{Name: "submarine-server", Namespace: namespace}, &deployment); err != nil {
+				return 0
+			}
+			if deployment.Spec.Replicas == nil {
+				return 0
+			}
+			return *deployment.Spec.Replicas
+		}, defaultWait, defaultPoll).Should(Equal(int32(3)))
+
+		Expect(deployment.Spec.Template.Spec.Containers[0].Image).To(Equal("apache/submarine:server-custom"))
+		Expect(deployment.Spec.Template.Spec.Containers[0].Env).To(ContainElement(corev1.EnvVar{Name: "NEW_ENV", Value: "1"}))
+		Expect(deployment.Spec.Template.Spec.ImagePullSecrets).To(ContainElement(corev1.LocalObjectReference{Name: "regcred"}))
+	})
+
+	It("recreates the Deployment if it is deleted out-of-band", func() {
+		NewSubmarineBuilder("server-drift", namespace).Create(ctx)
+
+		var deployment appsv1.Deployment
+		Eventually(func() error {
+			return k8sClient.Get(ctx, types.NamespacedName{Name: "submarine-server", Namespace: namespace}, &deployment)
+		}, defaultWait, defaultPoll).Should(Succeed())
+		originalUID := deployment.UID
+
+		Expect(k8sClient.Delete(ctx, &deployment)).To(Succeed())
+
+		Eventually(func() bool {
+			var recreated appsv1.Deployment
+			if err := k8sClient.Get(ctx, types.NamespacedName{Name: "submarine-server", Namespace: namespace}, &recreated); err != nil {
+				return false
+			}
+			return recreated.UID != originalUID
+		}, defaultWait, defaultPoll).Should(BeTrue(), fmt.Sprintf("expected the Owns() watch on %s to re-trigger reconcile and recreate the Deployment", namespace))
+	})
+})
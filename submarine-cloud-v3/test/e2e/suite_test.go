@@ -0,0 +1,113 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package e2e exercises the SubmarineReconciler end-to-end against a real
+// API server: envtest by default, or a KIND cluster in CI when
+// USE_EXISTING_CLUSTER=true is set (see .github/workflows for the CI job
+// that spins up KIND and points KUBECONFIG at it). envtest runs no
+// Deployment controller, so specs that wait on Deployment status, such as
+// the Running phase, only pass against a real cluster.
+package e2e
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+
+	submarineapacheorgv1alpha1 "github.com/apache/submarine/submarine-cloud-v3/api/v1alpha1"
+	"github.com/apache/submarine/submarine-cloud-v3/controllers"
+)
+
+// defaultWait/defaultPoll bound the Eventually()/WaitForSubmarinePhase calls
+// throughout this suite; the Deployment/HPA/PDB controllers of a real
+// cluster may take a few seconds to publish status after a patch.
+const (
+	defaultWait = 30 * time.Second
+	defaultPoll = 250 * time.Millisecond
+)
+
+var (
+	testEnv   *envtest.Environment
+	k8sClient client.Client
+	cancelMgr context.CancelFunc
+)
+
+func TestE2E(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Submarine controller e2e suite")
+}
+
+var _ = BeforeSuite(func() {
+	testEnv = &envtest.Environment{
+		CRDDirectoryPaths:     []string{filepath.Join("..", "..", "config", "crd", "bases")},
+		ErrorIfCRDPathMissing: true,
+		UseExistingCluster:    useExistingCluster(),
+	}
+
+	cfg, err := testEnv.Start()
+	Expect(err).NotTo(HaveOccurred())
+	Expect(cfg).NotTo(BeNil())
+
+	Expect(submarineapacheorgv1alpha1.AddToScheme(scheme.Scheme)).To(Succeed())
+
+	k8sClient, err = client.New(cfg, client.Options{Scheme: scheme.Scheme})
+	Expect(err).NotTo(HaveOccurred())
+	Expect(k8sClient).NotTo(BeNil())
+
+	mgr, err := ctrl.NewManager(cfg, ctrl.Options{Scheme: scheme.Scheme, MetricsBindAddress: "0"})
+	Expect(err).NotTo(HaveOccurred())
+
+	reconciler := &controllers.SubmarineReconciler{
+		Client:   mgr.GetClient(),
+		Scheme:   mgr.GetScheme(),
+		Log:      ctrl.Log.WithName("e2e").WithName("Submarine"),
+		Recorder: mgr.GetEventRecorderFor("submarine-controller"),
+	}
+	Expect(reconciler.SetupWithManager(mgr)).To(Succeed())
+
+	var ctx context.Context
+	ctx, cancelMgr = context.WithCancel(context.Background())
+	go func() {
+		defer GinkgoRecover()
+		Expect(mgr.Start(ctx)).To(Succeed())
+	}()
+})
+
+var _ = AfterSuite(func() {
+	if cancelMgr != nil {
+		cancelMgr()
+	}
+	Expect(testEnv.Stop()).To(Succeed())
+})
+
+// useExistingCluster reports whether the suite should run against a real
+// (e.g. KIND) cluster named by KUBECONFIG instead of spinning up envtest's
+// embedded control plane. Set by the CI e2e job.
+func useExistingCluster() *bool {
+	use := os.Getenv("USE_EXISTING_CLUSTER") == "true"
+	return &use
+}